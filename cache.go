@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	redisAccessTokenKey     = "redgifs:access_token"
+	redisAccessTokenTTL     = defaultMaxTokenAge
+	redisAccessTokenChannel = "redgifs:access_token:updates"
+	redisRefreshLockKey     = "redgifs:refresh_lock"
+	redisRefreshLockTTL     = 30 * time.Second
+	defaultGifCacheTTLSecs  = 60
+	redisContextTimeout     = 5 * time.Second
+)
+
+// RedisCache wraps a Redis client used to share the access token and cache
+// gif lookup responses across multiple server instances. A nil *RedisCache
+// is valid and every method on it is a no-op, so callers can fall back to
+// the existing in-memory sync.RWMutex path when Redis is not configured.
+type RedisCache struct {
+	client *redis.Client
+	gifTTL time.Duration
+}
+
+// setupRedisCache builds a RedisCache from config, returning nil if Redis
+// is not configured or unreachable so the caller falls back gracefully.
+func setupRedisCache(redGifsConfig RedGifsConfig) *RedisCache {
+	if len(redGifsConfig.RedisAddr) == 0 {
+		return nil
+	}
+
+	rdb := redis.NewClient(&redis.Options{
+		Addr:     redGifsConfig.RedisAddr,
+		Password: redGifsConfig.RedisPassword,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisContextTimeout)
+	defer cancel()
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		log.Printf("redis: could not reach %s, falling back to in-memory state: %v", redGifsConfig.RedisAddr, err)
+		return nil
+	}
+
+	ttl := time.Duration(redGifsConfig.GifCacheTTLSeconds) * time.Second
+	if redGifsConfig.GifCacheTTLSeconds == 0 {
+		ttl = defaultGifCacheTTLSecs * time.Second
+	}
+
+	cache := &RedisCache{client: rdb, gifTTL: ttl}
+	cache.seedAccessToken()
+	go cache.subscribeAccessToken()
+
+	return cache
+}
+
+// seedAccessToken adopts whatever access token another instance last
+// published to Redis, if any, so a freshly started instance with no local
+// BoltDB state doesn't have to wait for the next refresh's pub/sub
+// message (or perform a redundant refresh of its own) before it can serve
+// requests.
+func (r *RedisCache) seedAccessToken() {
+	if r == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisContextTimeout)
+	defer cancel()
+
+	accessToken, err := r.client.Get(ctx, redisAccessTokenKey).Result()
+	if err != nil || len(accessToken) == 0 {
+		return
+	}
+
+	credential.accessTokenMutex.Lock()
+	credential.accessToken = accessToken
+	credential.accessTokenMutex.Unlock()
+}
+
+// subscribeAccessToken listens for access tokens refreshed by other
+// instances and applies them to the shared in-memory credential so every
+// instance stays in sync without each of them hitting RedGifs.
+func (r *RedisCache) subscribeAccessToken() {
+	if r == nil {
+		return
+	}
+
+	sub := r.client.Subscribe(context.Background(), redisAccessTokenChannel)
+	defer sub.Close()
+
+	for msg := range sub.Channel() {
+		credential.accessTokenMutex.Lock()
+		credential.accessToken = msg.Payload
+		credential.accessTokenMutex.Unlock()
+	}
+}
+
+// acquireRefreshLock attempts to take a short-lived distributed lock so
+// only one instance refreshes the access token at a time. It returns false
+// when another instance already holds the lock.
+func (r *RedisCache) acquireRefreshLock() bool {
+	if r == nil {
+		return true
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisContextTimeout)
+	defer cancel()
+
+	ok, err := r.client.SetNX(ctx, redisRefreshLockKey, "1", redisRefreshLockTTL).Result()
+	if err != nil {
+		log.Printf("redis: refresh lock acquisition failed, proceeding without it: %v", err)
+		return true
+	}
+
+	return ok
+}
+
+// releaseRefreshLock releases the distributed refresh lock.
+func (r *RedisCache) releaseRefreshLock() {
+	if r == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisContextTimeout)
+	defer cancel()
+	_ = r.client.Del(ctx, redisRefreshLockKey).Err()
+}
+
+// publishAccessToken stores the freshly refreshed access token in Redis and
+// notifies other instances via pub/sub.
+func (r *RedisCache) publishAccessToken(accessToken string) {
+	if r == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisContextTimeout)
+	defer cancel()
+
+	if err := r.client.Set(ctx, redisAccessTokenKey, accessToken, redisAccessTokenTTL).Err(); err != nil {
+		log.Printf("redis: could not store access token: %v", err)
+	}
+
+	if err := r.client.Publish(ctx, redisAccessTokenChannel, accessToken).Err(); err != nil {
+		log.Printf("redis: could not publish access token: %v", err)
+	}
+}
+
+// getCachedStreamURL returns a previously cached stream URL for gifId, if
+// any is still within its TTL.
+func (r *RedisCache) getCachedStreamURL(gifId string) (string, bool) {
+	if r == nil {
+		return "", false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisContextTimeout)
+	defer cancel()
+
+	streamUrl, err := r.client.Get(ctx, gifStreamUrlKey(gifId)).Result()
+	if err != nil {
+		return "", false
+	}
+
+	return streamUrl, true
+}
+
+// cacheStreamURL stores a gif's stream URL for gifTTL.
+func (r *RedisCache) cacheStreamURL(gifId string, streamUrl string) {
+	if r == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisContextTimeout)
+	defer cancel()
+
+	if err := r.client.Set(ctx, gifStreamUrlKey(gifId), streamUrl, r.gifTTL).Err(); err != nil {
+		log.Printf("redis: could not cache stream url for %s: %v", gifId, err)
+	}
+}
+
+// gifStreamUrlKey builds the Redis key used to cache a gif's stream URL.
+func gifStreamUrlKey(gifId string) string {
+	return "redgifs:gif:" + gifId
+}
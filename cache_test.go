@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+// A nil *RedisCache must be a safe no-op on every method, since that's
+// what every caller gets when Redis isn't configured (see
+// setupRedisCache).
+func TestNilRedisCacheIsANoOp(t *testing.T) {
+	var r *RedisCache
+
+	if !r.acquireRefreshLock() {
+		t.Fatal("expected acquireRefreshLock to succeed when Redis isn't configured")
+	}
+
+	r.releaseRefreshLock()
+	r.publishAccessToken("some-token")
+	r.cacheStreamURL("abc123", "https://example.com/abc123.mp4")
+
+	if _, ok := r.getCachedStreamURL("abc123"); ok {
+		t.Fatal("expected getCachedStreamURL to report a miss")
+	}
+
+	r.subscribeAccessToken()
+}
+
+func TestGifStreamUrlKey(t *testing.T) {
+	if got, want := gifStreamUrlKey("abc123"), "redgifs:gif:abc123"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
@@ -4,9 +4,9 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"github.com/StellarReddit/RedGifsServer/transport"
 	"github.com/StellarReddit/RedGifsWrapper"
 	"github.com/labstack/echo/v4"
-	"github.com/robfig/cron/v3"
 	"github.com/spf13/viper"
 	"math/rand"
 	"net"
@@ -16,9 +16,12 @@ import (
 )
 
 var (
-	config     RedGifsConfig
-	client     RedGifsWrapper.Client
-	credential Credential
+	config           RedGifsConfig
+	client           RedGifsWrapper.Client
+	validationClient RedGifsWrapper.Client
+	credential       Credential
+	cache            *RedisCache
+	scheduler        *RefreshScheduler
 )
 
 const (
@@ -37,11 +40,20 @@ type Credential struct {
 }
 
 type RedGifsConfig struct {
-	ListenPort             string `mapstructure:"LISTEN_PORT"`
-	RedGifsClientId        string `mapstructure:"REDGIFS_CLIENT_ID"`
-	RedGifsClientSecret    string `mapstructure:"REDGIFS_CLIENT_SECRET"`
-	RedGifsTestId          string `mapstructure:"REDGIFS_TEST_ID"`
-	StellarClientUserAgent string `mapstructure:"STELLAR_CLIENT_USER_AGENT"`
+	ListenPort             string  `mapstructure:"LISTEN_PORT"`
+	RedGifsClientId        string  `mapstructure:"REDGIFS_CLIENT_ID"`
+	RedGifsClientSecret    string  `mapstructure:"REDGIFS_CLIENT_SECRET"`
+	RedGifsTestId          string  `mapstructure:"REDGIFS_TEST_ID"`
+	StellarClientUserAgent string  `mapstructure:"STELLAR_CLIENT_USER_AGENT"`
+	RedisAddr              string  `mapstructure:"REDIS_ADDR"`
+	RedisPassword          string  `mapstructure:"REDIS_PASSWORD"`
+	GifCacheTTLSeconds     int     `mapstructure:"GIF_CACHE_TTL_SECONDS"`
+	BoltDBPath             string  `mapstructure:"BOLTDB_PATH"`
+	RefreshWorkerInterval  string  `mapstructure:"STELLAR_REFRESH_WORKER_INTERVAL"`
+	RateLimitRPS           float64 `mapstructure:"RATE_LIMIT_RPS"`
+	RateLimitBurst         int     `mapstructure:"RATE_LIMIT_BURST"`
+	RateLimitAllowlist     string  `mapstructure:"RATE_LIMIT_ALLOWLIST"`
+	MaxInFlightUpstream    int     `mapstructure:"MAX_INFLIGHT_UPSTREAM_REQUESTS"`
 }
 
 type RedGifStreamUrlResponse struct {
@@ -61,12 +73,27 @@ func main() {
 
 	config = tempConfig
 
-	setupAccessTokenRefreshTask()
+	cache = setupRedisCache(config)
+
+	var schedulerErr error
+	scheduler, schedulerErr = setupRefreshScheduler(config)
+	if schedulerErr != nil {
+		panic(schedulerErr)
+	}
+	go scheduler.run()
+
 	setupRedGifsWrapperClient(config)
 
+	ipRateLimiter, err := newIPRateLimiter(config)
+	if err != nil {
+		panic(err)
+	}
+	upstreamSemaphore := newConcurrencySemaphore(config)
+
 	e := echo.New()
-	e.GET("/redgifs/gif/:id", handleGifLookup)
 	e.IPExtractor = echo.ExtractIPFromXFFHeader()
+	e.GET("/redgifs/gif/:id", handleGifLookup, ipRateLimiter.middleware(), upstreamSemaphore.middleware())
+	registerObservabilityRoutes(e)
 	e.Logger.Fatal(e.Start(config.ListenPort))
 }
 
@@ -74,72 +101,156 @@ func main() {
 func handleGifLookup(c echo.Context) error {
 	gifId := c.Param("id")
 
+	if streamUrl, ok := cache.getCachedStreamURL(gifId); ok {
+		lookupRequestsTotal.WithLabelValues("ok").Inc()
+		var response RedGifStreamUrlResponse
+		response.Url = streamUrl
+		return c.JSON(http.StatusOK, response)
+	}
+
 	credential.accessTokenMutex.RLock()
 	accessToken := credential.accessToken
 	credential.accessTokenMutex.RUnlock()
 
+	upstreamStart := time.Now()
 	streamUrl, err := client.LookupStreamURL(c.RealIP(), config.StellarClientUserAgent, gifId, accessToken)
+	upstreamLatency.Observe(time.Since(upstreamStart).Seconds())
+
 	if errors.Is(err, RedGifsWrapper.ErrNotFound) {
+		lookupRequestsTotal.WithLabelValues("not_found").Inc()
 		return c.String(http.StatusNotFound, "Could not find the stream url for the gif.")
+	} else if errors.Is(err, RedGifsWrapper.ErrNotAuthorized) {
+		lookupRequestsTotal.WithLabelValues("error").Inc()
+		scheduler.notifyUnauthorized()
+		return c.String(http.StatusInternalServerError, "Something went wrong requesting the gif.")
 	} else if err != nil {
+		lookupRequestsTotal.WithLabelValues("error").Inc()
 		return c.String(http.StatusInternalServerError, "Something went wrong requesting the gif.")
 	} else {
+		lookupRequestsTotal.WithLabelValues("ok").Inc()
+		cache.cacheStreamURL(gifId, streamUrl)
+
 		var response RedGifStreamUrlResponse
 		response.Url = streamUrl
 		return c.JSON(http.StatusOK, response)
 	}
 }
 
-// setupAccessTokenRefreshTask - Run the refresh task on Saturdays at midnight
-func setupAccessTokenRefreshTask() {
-	c := cron.New()
-	_, _ = c.AddFunc("@weekly", func() {
-		attemptAccessTokenRefresh()
-	})
-	c.Start()
-}
-
-// setupRedGifsWrapperClient - Set up the RedGifs wrapper
+// setupRedGifsWrapperClient - Set up the RedGifs wrapper clients. client's
+// http.Client is built from the full transport chain: rate limiting,
+// retries, auth injection and user-agent stamping apply to every call site
+// this way rather than being reimplemented per call. validationClient
+// shares everything except auth injection, since its one caller,
+// attemptAccessTokenRefresh, always passes an explicit token to validate
+// and must not have it replaced by AuthTransport with the current
+// credential.accessToken.
 func setupRedGifsWrapperClient(redGifsConfig RedGifsConfig) {
 	redGifsWrapperConfig := RedGifsWrapper.Config{
 		ClientID:     redGifsConfig.RedGifsClientId,
 		ClientSecret: redGifsConfig.RedGifsClientSecret,
 		UserAgent:    ServerUserAgent,
+		HTTPClient:   http.Client{Transport: buildRedGifsTransport()},
 	}
-
 	client = RedGifsWrapper.NewClient(redGifsWrapperConfig)
+
+	validationConfig := redGifsWrapperConfig
+	validationConfig.HTTPClient = http.Client{Transport: buildValidationTransport()}
+	validationClient = RedGifsWrapper.NewClient(validationConfig)
 }
 
-// attemptAccessTokenRefresh - Attempts to refresh the access token up to 5 times.
-// Importantly, it validates tests the token is valid. Sometimes RedGifs issues
-// broken tokens.
-func attemptAccessTokenRefresh() {
-	backoff := [5]time.Duration{5, 10, 30, 60, 120}
+// buildRedGifsTransport assembles the http.RoundTripper chain used for
+// every request to RedGifs: user-agent stamping, auth injection (with
+// token-refresh-and-retry on 401), upstream retries, then per-host rate
+// limiting closest to the wire.
+func buildRedGifsTransport() http.RoundTripper {
+	var rt http.RoundTripper = &transport.RateLimitTransport{
+		Rate:  5,
+		Burst: 10,
+	}
+
+	rt = &transport.RetryTransport{Next: rt}
+
+	rt = &transport.AuthTransport{
+		Next: rt,
+		TokenProvider: func() string {
+			credential.accessTokenMutex.RLock()
+			defer credential.accessTokenMutex.RUnlock()
+			return credential.accessToken
+		},
+		OnUnauthorized: attemptAccessTokenRefresh,
+	}
 
-	for _, v := range backoff {
-		accessToken, err := client.RequestNewAccessToken()
+	return &transport.UserAgentTransport{Next: rt, UserAgent: ServerUserAgent}
+}
 
-		if err != nil {
-			time.Sleep(v * time.Second)
-			continue
-		}
+// buildValidationTransport assembles the same chain as
+// buildRedGifsTransport but without AuthTransport, so a caller supplying
+// its own explicit token (see validationClient) still gets retries and
+// rate limiting without that token being overwritten.
+func buildValidationTransport() http.RoundTripper {
+	var rt http.RoundTripper = &transport.RateLimitTransport{
+		Rate:  5,
+		Burst: 10,
+	}
 
-		// Wait for the token to become active
-		time.Sleep(5 * time.Second)
+	rt = &transport.RetryTransport{Next: rt}
 
-		randomIp := generateRandomIPv4Address()
-		_, err = client.LookupStreamURL(randomIp, ServerUserAgent, config.RedGifsTestId, accessToken)
+	return &transport.UserAgentTransport{Next: rt, UserAgent: ServerUserAgent}
+}
 
-		if err != nil {
-			time.Sleep(v * time.Second)
-			continue
-		}
+// refreshMutex serializes attemptAccessTokenRefresh within this process.
+// cache.acquireRefreshLock only guards across instances (and is a no-op
+// when Redis isn't configured), but refresh can now be triggered by any
+// in-flight request handler on a 401 as well as the scheduler, so without
+// this a broad outage would storm RequestNewAccessToken from every
+// goroutine at once.
+var refreshMutex sync.Mutex
+
+// attemptAccessTokenRefresh - Requests a new access token and validates it
+// actually works before adopting it. Sometimes RedGifs issues broken
+// tokens. Retries against transient upstream failures are handled by
+// transport.RetryTransport, so this makes a single attempt. If a refresh
+// is already under way, concurrent callers return immediately rather than
+// piling up behind it.
+func attemptAccessTokenRefresh() {
+	if !refreshMutex.TryLock() {
+		return
+	}
+	defer refreshMutex.Unlock()
 
-		credential.accessTokenMutex.Lock()
-		credential.accessToken = accessToken
-		credential.accessTokenMutex.Unlock()
-		break
+	if !cache.acquireRefreshLock() {
+		return
 	}
+	defer cache.releaseRefreshLock()
+
+	tokenRefreshAttemptsTotal.Inc()
+
+	accessToken, err := client.RequestNewAccessToken()
+	if err != nil {
+		tokenRefreshFailuresTotal.Inc()
+		markRefreshed(false)
+		scheduler.recordAttempt(false, "")
+		return
+	}
+
+	// Wait for the token to become active
+	time.Sleep(5 * time.Second)
+
+	randomIp := generateRandomIPv4Address()
+	_, err = validationClient.LookupStreamURL(randomIp, ServerUserAgent, config.RedGifsTestId, accessToken)
+	if err != nil {
+		tokenRefreshFailuresTotal.Inc()
+		markRefreshed(false)
+		scheduler.recordAttempt(false, "")
+		return
+	}
+
+	credential.accessTokenMutex.Lock()
+	credential.accessToken = accessToken
+	credential.accessTokenMutex.Unlock()
+	cache.publishAccessToken(accessToken)
+	markRefreshed(true)
+	scheduler.recordAttempt(true, accessToken)
 }
 
 // generateRandomIPv4Address - generate a random IPv4 address for testing
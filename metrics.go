@@ -0,0 +1,138 @@
+package main
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	lookupRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "redgifs_server_lookup_requests_total",
+		Help: "Total number of gif lookup requests, labeled by outcome.",
+	}, []string{"outcome"})
+
+	upstreamLatency = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "redgifs_server_upstream_latency_seconds",
+		Help:    "Latency of calls to RedGifs' LookupStreamURL.",
+		Buckets: prometheus.DefBuckets,
+	})
+
+	tokenRefreshAttemptsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "redgifs_server_token_refresh_attempts_total",
+		Help: "Total number of access token refresh attempts.",
+	})
+
+	tokenRefreshFailuresTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "redgifs_server_token_refresh_failures_total",
+		Help: "Total number of access token refresh attempts that failed to request or validate a new token.",
+	})
+
+	tokenAgeSeconds = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "redgifs_server_token_age_seconds",
+		Help: "Age in seconds of the currently held access token.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(
+		lookupRequestsTotal,
+		upstreamLatency,
+		tokenRefreshAttemptsTotal,
+		tokenRefreshFailuresTotal,
+		tokenAgeSeconds,
+	)
+}
+
+// readiness tracks the state Kubernetes and load balancers use to decide
+// whether this instance should receive traffic.
+type readiness struct {
+	everRefreshed       int32
+	lastRefreshUnixNano int64
+}
+
+var ready readiness
+
+// markRefreshed records that attemptAccessTokenRefresh has successfully set
+// credential.accessToken at least once, as of now. A failed attempt is a
+// no-op here: it's already counted by tokenRefreshFailuresTotal, and with
+// refreshes now triggered by any upstream 401 as well as the hourly
+// worker, a single transient failure shouldn't by itself pull a
+// still-fresh token out of rotation.
+func markRefreshed(ok bool) {
+	if !ok {
+		return
+	}
+
+	markRefreshedAt(time.Now())
+}
+
+// markRefreshedAt is markRefreshed's underlying implementation, taking the
+// refresh time explicitly so RefreshScheduler.restore can seed readiness
+// from the persisted last_successful_refresh instead of the restart time.
+func markRefreshedAt(t time.Time) {
+	atomic.StoreInt32(&ready.everRefreshed, 1)
+	atomic.StoreInt64(&ready.lastRefreshUnixNano, t.UnixNano())
+	tokenAgeSeconds.Set(time.Since(t).Seconds())
+}
+
+// IsReady reports whether the server is ready to serve traffic: the token
+// has been set at least once and isn't older than the scheduler's
+// maxTokenAge, regardless of whether a refresh has been attempted since.
+func (readiness) IsReady() bool {
+	if atomic.LoadInt32(&ready.everRefreshed) != 1 {
+		return false
+	}
+
+	maxTokenAge := defaultMaxTokenAge
+	if scheduler != nil {
+		maxTokenAge = scheduler.maxTokenAge
+	}
+
+	lastRefresh := time.Unix(0, atomic.LoadInt64(&ready.lastRefreshUnixNano))
+	return time.Since(lastRefresh) <= maxTokenAge
+}
+
+// registerObservabilityRoutes wires /metrics, /healthz and /readyz onto e.
+func registerObservabilityRoutes(e *echo.Echo) {
+	e.GET("/metrics", echo.WrapHandler(promhttp.Handler()))
+	e.GET("/healthz", handleHealthz)
+	e.GET("/readyz", handleReadyz)
+
+	go trackTokenAge()
+}
+
+// handleHealthz - Reports that the process is alive.
+func handleHealthz(c echo.Context) error {
+	return c.NoContent(http.StatusOK)
+}
+
+// handleReadyz - Reports 503 until the access token has been set at least
+// once and isn't older than the scheduler's maxTokenAge.
+func handleReadyz(c echo.Context) error {
+	if !ready.IsReady() {
+		return c.NoContent(http.StatusServiceUnavailable)
+	}
+
+	return c.NoContent(http.StatusOK)
+}
+
+// trackTokenAge periodically updates the token age gauge so it keeps
+// advancing between refreshes rather than only updating on a new token.
+func trackTokenAge() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if atomic.LoadInt32(&ready.everRefreshed) != 1 {
+			continue
+		}
+
+		lastRefresh := time.Unix(0, atomic.LoadInt64(&ready.lastRefreshUnixNano))
+		tokenAgeSeconds.Set(time.Since(lastRefresh).Seconds())
+	}
+}
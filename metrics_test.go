@@ -0,0 +1,83 @@
+package main
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// resetReadiness clears the package-level readiness singleton and
+// scheduler override around a test, restoring both afterward.
+func resetReadiness(t *testing.T) {
+	t.Helper()
+
+	prevEverRefreshed := atomic.LoadInt32(&ready.everRefreshed)
+	prevLastRefresh := atomic.LoadInt64(&ready.lastRefreshUnixNano)
+	prevScheduler := scheduler
+
+	atomic.StoreInt32(&ready.everRefreshed, 0)
+	atomic.StoreInt64(&ready.lastRefreshUnixNano, 0)
+	scheduler = nil
+
+	t.Cleanup(func() {
+		atomic.StoreInt32(&ready.everRefreshed, prevEverRefreshed)
+		atomic.StoreInt64(&ready.lastRefreshUnixNano, prevLastRefresh)
+		scheduler = prevScheduler
+	})
+}
+
+func TestIsReadyBeforeAnyRefresh(t *testing.T) {
+	resetReadiness(t)
+
+	if ready.IsReady() {
+		t.Fatal("expected not ready before any refresh has succeeded")
+	}
+}
+
+func TestMarkRefreshedFalseIsANoOp(t *testing.T) {
+	resetReadiness(t)
+
+	markRefreshed(false)
+
+	if ready.IsReady() {
+		t.Fatal("expected a failed attempt not to affect readiness")
+	}
+}
+
+func TestMarkRefreshedTrueMakesReady(t *testing.T) {
+	resetReadiness(t)
+
+	markRefreshed(true)
+
+	if !ready.IsReady() {
+		t.Fatal("expected a successful refresh to make the instance ready")
+	}
+}
+
+func TestIsReadyFalseOnceTokenOlderThanMaxTokenAge(t *testing.T) {
+	resetReadiness(t)
+	scheduler = &RefreshScheduler{maxTokenAge: time.Hour}
+
+	markRefreshedAt(time.Now().Add(-2 * time.Hour))
+
+	if ready.IsReady() {
+		t.Fatal("expected readiness to expire once the token is older than maxTokenAge")
+	}
+}
+
+func TestMarkRefreshedAtSeedsTheGivenTimeNotNow(t *testing.T) {
+	resetReadiness(t)
+	scheduler = &RefreshScheduler{maxTokenAge: 24 * time.Hour}
+
+	almostStale := time.Now().Add(-23 * time.Hour)
+	markRefreshedAt(almostStale)
+
+	if !ready.IsReady() {
+		t.Fatal("expected the instance to still be ready just inside maxTokenAge")
+	}
+
+	got := time.Unix(0, atomic.LoadInt64(&ready.lastRefreshUnixNano))
+	if !got.Equal(almostStale) {
+		t.Fatalf("expected lastRefreshUnixNano to be seeded from the given time %v, got %v", almostStale, got)
+	}
+}
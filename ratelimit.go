@@ -0,0 +1,163 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/time/rate"
+)
+
+const (
+	defaultRateLimitRPS         = 5
+	defaultRateLimitBurst       = 10
+	defaultRateLimiterCacheSize = 10_000
+	defaultMaxInFlightUpstream  = 50
+)
+
+// IPRateLimiter enforces a per-client-IP token bucket, backed by an LRU so
+// the limiter map can't grow unbounded under a spread-out abusive client
+// base. IPs in the allowlist bypass the limiter entirely.
+type IPRateLimiter struct {
+	limiters  *lru.Cache[string, *rate.Limiter]
+	rps       rate.Limit
+	burst     int
+	allowlist []*net.IPNet
+}
+
+// newIPRateLimiter builds an IPRateLimiter from config, applying the
+// documented defaults when RATE_LIMIT_RPS / RATE_LIMIT_BURST are unset.
+func newIPRateLimiter(redGifsConfig RedGifsConfig) (*IPRateLimiter, error) {
+	rps := rate.Limit(defaultRateLimitRPS)
+	if redGifsConfig.RateLimitRPS > 0 {
+		rps = rate.Limit(redGifsConfig.RateLimitRPS)
+	}
+
+	burst := defaultRateLimitBurst
+	if redGifsConfig.RateLimitBurst > 0 {
+		burst = redGifsConfig.RateLimitBurst
+	}
+
+	cache, err := lru.New[string, *rate.Limiter](defaultRateLimiterCacheSize)
+	if err != nil {
+		return nil, err
+	}
+
+	allowlist, err := parseAllowlist(redGifsConfig.RateLimitAllowlist)
+	if err != nil {
+		return nil, err
+	}
+
+	return &IPRateLimiter{limiters: cache, rps: rps, burst: burst, allowlist: allowlist}, nil
+}
+
+// parseAllowlist parses a comma-separated list of CIDRs.
+func parseAllowlist(raw string) ([]*net.IPNet, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+
+	var nets []*net.IPNet
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if len(entry) == 0 {
+			continue
+		}
+
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, err
+		}
+
+		nets = append(nets, ipNet)
+	}
+
+	return nets, nil
+}
+
+// allowlisted reports whether ip falls within a configured allowlist CIDR.
+func (l *IPRateLimiter) allowlisted(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+
+	for _, ipNet := range l.allowlist {
+		if ipNet.Contains(parsed) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// allow reports whether a request from ip is within its rate limit,
+// creating a new bucket for ip on first use.
+func (l *IPRateLimiter) allow(ip string) bool {
+	if l.allowlisted(ip) {
+		return true
+	}
+
+	limiter, ok := l.limiters.Get(ip)
+	if !ok {
+		limiter = rate.NewLimiter(l.rps, l.burst)
+		l.limiters.Add(ip, limiter)
+	}
+
+	return limiter.Allow()
+}
+
+// middleware returns an echo.MiddlewareFunc that rejects requests over the
+// per-IP rate limit with a 429 and a Retry-After header.
+func (l *IPRateLimiter) middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if !l.allow(c.RealIP()) {
+				c.Response().Header().Set("Retry-After", strconv.Itoa(1))
+				return c.NoContent(http.StatusTooManyRequests)
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// concurrencySemaphore bounds the number of in-flight upstream requests so
+// a traffic spike can't exhaust file descriptors or trip RedGifs' own rate
+// limiter for every user at once.
+type concurrencySemaphore struct {
+	slots chan struct{}
+}
+
+// newConcurrencySemaphore builds a concurrencySemaphore with the
+// configured max in-flight upstream requests, falling back to
+// defaultMaxInFlightUpstream when unset.
+func newConcurrencySemaphore(redGifsConfig RedGifsConfig) *concurrencySemaphore {
+	max := defaultMaxInFlightUpstream
+	if redGifsConfig.MaxInFlightUpstream > 0 {
+		max = redGifsConfig.MaxInFlightUpstream
+	}
+
+	return &concurrencySemaphore{slots: make(chan struct{}, max)}
+}
+
+// middleware returns an echo.MiddlewareFunc that rejects requests with 503
+// when the concurrency semaphore is full.
+func (s *concurrencySemaphore) middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			select {
+			case s.slots <- struct{}{}:
+			default:
+				return c.NoContent(http.StatusServiceUnavailable)
+			}
+
+			defer func() { <-s.slots }()
+
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import "testing"
+
+func TestParseAllowlist(t *testing.T) {
+	t.Run("empty string yields no entries", func(t *testing.T) {
+		nets, err := parseAllowlist("")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if nets != nil {
+			t.Fatalf("expected nil, got %v", nets)
+		}
+	})
+
+	t.Run("parses comma-separated CIDRs and trims whitespace", func(t *testing.T) {
+		nets, err := parseAllowlist("10.0.0.0/8, 192.168.1.0/24")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(nets) != 2 {
+			t.Fatalf("expected 2 entries, got %d", len(nets))
+		}
+	})
+
+	t.Run("rejects an invalid CIDR", func(t *testing.T) {
+		if _, err := parseAllowlist("not-a-cidr"); err == nil {
+			t.Fatal("expected an error for an invalid CIDR")
+		}
+	})
+}
+
+func TestIPRateLimiterAllow(t *testing.T) {
+	t.Run("allows up to burst then rejects", func(t *testing.T) {
+		limiter, err := newIPRateLimiter(RedGifsConfig{RateLimitRPS: 1, RateLimitBurst: 2})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if !limiter.allow("1.2.3.4") {
+			t.Fatal("expected first request to be allowed")
+		}
+		if !limiter.allow("1.2.3.4") {
+			t.Fatal("expected second request to be allowed (within burst)")
+		}
+		if limiter.allow("1.2.3.4") {
+			t.Fatal("expected third request to be rejected once burst is exhausted")
+		}
+	})
+
+	t.Run("tracks separate buckets per IP", func(t *testing.T) {
+		limiter, err := newIPRateLimiter(RedGifsConfig{RateLimitRPS: 1, RateLimitBurst: 1})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if !limiter.allow("1.2.3.4") {
+			t.Fatal("expected first IP's request to be allowed")
+		}
+		if !limiter.allow("5.6.7.8") {
+			t.Fatal("expected a different IP's request to be allowed independently")
+		}
+	})
+
+	t.Run("bypasses the limit for an allowlisted IP", func(t *testing.T) {
+		limiter, err := newIPRateLimiter(RedGifsConfig{RateLimitRPS: 1, RateLimitBurst: 1, RateLimitAllowlist: "1.2.3.0/24"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		for i := 0; i < 5; i++ {
+			if !limiter.allow("1.2.3.4") {
+				t.Fatalf("expected allowlisted IP to always be allowed, failed on request %d", i+1)
+			}
+		}
+	})
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/binary"
+	"log"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	refreshStateBucket       = "refresh_state"
+	keyLastSuccessfulRefresh = "last_successful_refresh"
+	keyLastAttempt           = "last_attempt"
+	keyConsecutiveFailures   = "consecutive_failures"
+	keyAccessToken           = "access_token"
+
+	defaultBoltDBPath            = "redgifs.db"
+	defaultMaxTokenAge           = 6 * 24 * time.Hour
+	defaultRefreshWorkerInterval = time.Hour
+)
+
+// RefreshScheduler persists token refresh state in BoltDB so the server
+// resumes immediately after a restart instead of waiting for the next
+// scheduled tick. The consecutive failure count is persisted too, but run
+// does not consult it: refresh attempts are not delayed after failures.
+type RefreshScheduler struct {
+	db             *bolt.DB
+	maxTokenAge    time.Duration
+	workerInterval time.Duration
+	unauthorizedCh chan struct{}
+}
+
+// setupRefreshScheduler opens the BoltDB file, restores any persisted
+// state, and returns a scheduler ready to have run() started in the
+// background.
+func setupRefreshScheduler(redGifsConfig RedGifsConfig) (*RefreshScheduler, error) {
+	path := redGifsConfig.BoltDBPath
+	if len(path) == 0 {
+		path = defaultBoltDBPath
+	}
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(refreshStateBucket))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	interval := defaultRefreshWorkerInterval
+	if len(redGifsConfig.RefreshWorkerInterval) > 0 {
+		if d, err := time.ParseDuration(redGifsConfig.RefreshWorkerInterval); err == nil {
+			interval = d
+		}
+	}
+
+	s := &RefreshScheduler{
+		db:             db,
+		maxTokenAge:    defaultMaxTokenAge,
+		workerInterval: interval,
+		unauthorizedCh: make(chan struct{}, 1),
+	}
+
+	s.restore()
+
+	return s, nil
+}
+
+// restore adopts the persisted access token, if any, so the server is
+// ready to serve traffic immediately instead of waiting for the next
+// refresh.
+func (s *RefreshScheduler) restore() {
+	token, lastSuccess, _, _ := s.load()
+	if len(token) == 0 {
+		return
+	}
+
+	credential.accessTokenMutex.Lock()
+	credential.accessToken = token
+	credential.accessTokenMutex.Unlock()
+
+	if time.Since(lastSuccess) <= s.maxTokenAge {
+		markRefreshedAt(lastSuccess)
+	}
+}
+
+// load reads the persisted refresh state from BoltDB.
+func (s *RefreshScheduler) load() (token string, lastSuccessfulRefresh time.Time, lastAttempt time.Time, consecutiveFailures int) {
+	_ = s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(refreshStateBucket))
+		if b == nil {
+			return nil
+		}
+
+		token = string(b.Get([]byte(keyAccessToken)))
+		lastSuccessfulRefresh = decodeTime(b.Get([]byte(keyLastSuccessfulRefresh)))
+		lastAttempt = decodeTime(b.Get([]byte(keyLastAttempt)))
+		consecutiveFailures = int(decodeUint64(b.Get([]byte(keyConsecutiveFailures))))
+		return nil
+	})
+
+	return
+}
+
+// recordAttempt persists the outcome of a refresh attempt: last_attempt
+// always advances, while last_successful_refresh and the token only
+// advance on success. consecutive_failures resets on success and
+// increments on failure, and its count survives a restart; nothing reads
+// it to back off between attempts.
+func (s *RefreshScheduler) recordAttempt(success bool, accessToken string) {
+	now := time.Now()
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(refreshStateBucket))
+
+		if err := b.Put([]byte(keyLastAttempt), encodeTime(now)); err != nil {
+			return err
+		}
+
+		if success {
+			if err := b.Put([]byte(keyLastSuccessfulRefresh), encodeTime(now)); err != nil {
+				return err
+			}
+			if err := b.Put([]byte(keyAccessToken), []byte(accessToken)); err != nil {
+				return err
+			}
+			return b.Put([]byte(keyConsecutiveFailures), encodeUint64(0))
+		}
+
+		failures := decodeUint64(b.Get([]byte(keyConsecutiveFailures)))
+		return b.Put([]byte(keyConsecutiveFailures), encodeUint64(failures+1))
+	})
+	if err != nil {
+		log.Printf("boltdb: could not persist refresh state: %v", err)
+	}
+}
+
+// run ticks on workerInterval, triggering a refresh when the stored token
+// is older than maxTokenAge, or immediately when notified of an upstream
+// 401 via unauthorizedCh.
+func (s *RefreshScheduler) run() {
+	ticker := time.NewTicker(s.workerInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			_, lastSuccess, _, _ := s.load()
+			if time.Since(lastSuccess) > s.maxTokenAge {
+				attemptAccessTokenRefresh()
+			}
+		case <-s.unauthorizedCh:
+			attemptAccessTokenRefresh()
+		}
+	}
+}
+
+// notifyUnauthorized signals the worker that upstream returned a 401 so it
+// refreshes sooner than the next scheduled tick.
+func (s *RefreshScheduler) notifyUnauthorized() {
+	select {
+	case s.unauthorizedCh <- struct{}{}:
+	default:
+	}
+}
+
+// encodeTime / decodeTime persist a time.Time as its binary encoding.
+func encodeTime(t time.Time) []byte {
+	b, _ := t.MarshalBinary()
+	return b
+}
+
+func decodeTime(b []byte) time.Time {
+	var t time.Time
+	if len(b) == 0 {
+		return t
+	}
+	_ = t.UnmarshalBinary(b)
+	return t
+}
+
+// encodeUint64 / decodeUint64 persist consecutive_failures as a big-endian
+// uint64.
+func encodeUint64(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
+
+func decodeUint64(b []byte) uint64 {
+	if len(b) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(b)
+}
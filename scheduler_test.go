@@ -0,0 +1,99 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestEncodeDecodeTimeRoundTrip(t *testing.T) {
+	want := time.Now()
+
+	got := decodeTime(encodeTime(want))
+	if !got.Equal(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestDecodeTimeEmpty(t *testing.T) {
+	if got := decodeTime(nil); !got.IsZero() {
+		t.Fatalf("expected zero time for nil input, got %v", got)
+	}
+}
+
+func TestEncodeDecodeUint64RoundTrip(t *testing.T) {
+	want := uint64(42)
+
+	got := decodeUint64(encodeUint64(want))
+	if got != want {
+		t.Fatalf("got %d, want %d", got, want)
+	}
+}
+
+func TestDecodeUint64Malformed(t *testing.T) {
+	if got := decodeUint64([]byte{1, 2, 3}); got != 0 {
+		t.Fatalf("expected 0 for malformed input, got %d", got)
+	}
+}
+
+func newTestScheduler(t *testing.T) *RefreshScheduler {
+	t.Helper()
+
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "refresh.db"), 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("could not open test BoltDB: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(refreshStateBucket))
+		return err
+	})
+	if err != nil {
+		t.Fatalf("could not create bucket: %v", err)
+	}
+
+	return &RefreshScheduler{db: db, maxTokenAge: defaultMaxTokenAge, workerInterval: defaultRefreshWorkerInterval}
+}
+
+func TestRecordAttemptSuccessPersistsTokenAndResetsFailures(t *testing.T) {
+	s := newTestScheduler(t)
+
+	s.recordAttempt(false, "")
+	s.recordAttempt(false, "")
+	s.recordAttempt(true, "abc123")
+
+	token, lastSuccess, lastAttempt, failures := s.load()
+	if token != "abc123" {
+		t.Fatalf("expected persisted token %q, got %q", "abc123", token)
+	}
+	if failures != 0 {
+		t.Fatalf("expected consecutive_failures to reset to 0, got %d", failures)
+	}
+	if lastSuccess.IsZero() || lastAttempt.IsZero() {
+		t.Fatal("expected both last_successful_refresh and last_attempt to be set")
+	}
+}
+
+func TestRecordAttemptFailureIncrementsConsecutiveFailures(t *testing.T) {
+	s := newTestScheduler(t)
+
+	s.recordAttempt(false, "")
+	s.recordAttempt(false, "")
+
+	token, lastSuccess, lastAttempt, failures := s.load()
+	if token != "" {
+		t.Fatalf("expected no token persisted on failure, got %q", token)
+	}
+	if !lastSuccess.IsZero() {
+		t.Fatal("expected last_successful_refresh to remain unset")
+	}
+	if lastAttempt.IsZero() {
+		t.Fatal("expected last_attempt to be set")
+	}
+	if failures != 2 {
+		t.Fatalf("expected consecutive_failures to be 2, got %d", failures)
+	}
+}
@@ -0,0 +1,176 @@
+// Package transport provides composable http.RoundTripper middlewares used
+// to build the HTTP client that talks to RedGifs, so cross-cutting concerns
+// like auth injection, retries, user-agent stamping and rate limiting can be
+// layered independently instead of living inside the RedGifs wrapper.
+package transport
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// AuthTransport injects the current access token into every request and
+// retries once on a 401 after triggering a token refresh.
+type AuthTransport struct {
+	Next           http.RoundTripper
+	TokenProvider  func() string
+	OnUnauthorized func()
+}
+
+// RoundTrip - Implements http.RoundTripper.
+func (t *AuthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.doRequest(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized || t.OnUnauthorized == nil {
+		return resp, err
+	}
+
+	t.OnUnauthorized()
+
+	_ = resp.Body.Close()
+	return t.doRequest(req)
+}
+
+// doRequest clones req with the current access token applied and sends it
+// through the next transport in the chain.
+func (t *AuthTransport) doRequest(req *http.Request) (*http.Response, error) {
+	clone := req.Clone(req.Context())
+	clone.Header.Set("Authorization", "Bearer "+t.TokenProvider())
+	return next(t.Next).RoundTrip(clone)
+}
+
+// UserAgentTransport stamps every request with a fixed User-Agent.
+type UserAgentTransport struct {
+	Next      http.RoundTripper
+	UserAgent string
+}
+
+// RoundTrip - Implements http.RoundTripper.
+func (t *UserAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	clone := req.Clone(req.Context())
+	clone.Header.Set("User-Agent", t.UserAgent)
+	return next(t.Next).RoundTrip(clone)
+}
+
+// RetryTransport retries requests that fail with a 5xx or 429 status using
+// exponential backoff, honoring a Retry-After header when present.
+type RetryTransport struct {
+	Next       http.RoundTripper
+	MaxRetries int
+	BaseDelay  time.Duration
+}
+
+// RoundTrip - Implements http.RoundTripper.
+func (t *RetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	maxRetries := t.MaxRetries
+	if maxRetries <= 0 {
+		maxRetries = 3
+	}
+
+	baseDelay := t.BaseDelay
+	if baseDelay <= 0 {
+		baseDelay = 500 * time.Millisecond
+	}
+
+	var resp *http.Response
+	var err error
+
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		if attempt > 0 && req.GetBody != nil {
+			body, bodyErr := req.GetBody()
+			if bodyErr != nil {
+				return nil, bodyErr
+			}
+			req.Body = body
+		}
+
+		resp, err = next(t.Next).RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < http.StatusInternalServerError {
+			return resp, nil
+		}
+
+		if attempt == maxRetries {
+			return resp, nil
+		}
+
+		delay := retryAfter(resp)
+		if delay == 0 {
+			delay = baseDelay * time.Duration(math.Pow(2, float64(attempt)))
+		}
+
+		_ = resp.Body.Close()
+		time.Sleep(delay)
+	}
+
+	return resp, err
+}
+
+// retryAfter parses the Retry-After header, returning 0 if absent or
+// unparseable.
+func retryAfter(resp *http.Response) time.Duration {
+	header := resp.Header.Get("Retry-After")
+	if header == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(header); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+
+	return 0
+}
+
+// RateLimitTransport enforces a token-bucket rate limit per upstream host.
+type RateLimitTransport struct {
+	Next    http.RoundTripper
+	Rate    rate.Limit
+	Burst   int
+	mu      sync.Mutex
+	buckets map[string]*rate.Limiter
+}
+
+// RoundTrip - Implements http.RoundTripper.
+func (t *RateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	limiter := t.limiterFor(req.URL.Host)
+	if err := limiter.Wait(req.Context()); err != nil {
+		return nil, err
+	}
+
+	return next(t.Next).RoundTrip(req)
+}
+
+// limiterFor returns the rate.Limiter for host, creating one on first use.
+func (t *RateLimitTransport) limiterFor(host string) *rate.Limiter {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.buckets == nil {
+		t.buckets = make(map[string]*rate.Limiter)
+	}
+
+	limiter, ok := t.buckets[host]
+	if !ok {
+		limiter = rate.NewLimiter(t.Rate, t.Burst)
+		t.buckets[host] = limiter
+	}
+
+	return limiter
+}
+
+// next returns http.DefaultTransport when rt is nil, so each middleware can
+// be used standalone without wiring up the full chain.
+func next(rt http.RoundTripper) http.RoundTripper {
+	if rt == nil {
+		return http.DefaultTransport
+	}
+
+	return rt
+}
@@ -0,0 +1,148 @@
+package transport
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestAuthTransportInjectsToken(t *testing.T) {
+	var gotAuth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	rt := &AuthTransport{TokenProvider: func() string { return "current-token" }}
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if gotAuth != "Bearer current-token" {
+		t.Fatalf("expected injected token, got %q", gotAuth)
+	}
+}
+
+func TestAuthTransportRetriesOnceOn401(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	var refreshCalled bool
+	rt := &AuthTransport{
+		TokenProvider:  func() string { return "current-token" },
+		OnUnauthorized: func() { refreshCalled = true },
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if !refreshCalled {
+		t.Fatal("expected OnUnauthorized to be called on a 401")
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected the retry to succeed, got status %d", resp.StatusCode)
+	}
+	if atomic.LoadInt32(&requests) != 2 {
+		t.Fatalf("expected exactly one retry (2 requests total), got %d", requests)
+	}
+}
+
+func TestRetryTransportRewindsBodyOnRetry(t *testing.T) {
+	var attempts int32
+	var gotBodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotBodies = append(gotBodies, string(body))
+
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	rt := &RetryTransport{BaseDelay: 0}
+
+	req, _ := http.NewRequest(http.MethodPost, server.URL, strings.NewReader("client_id=abc"))
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if len(gotBodies) != 2 {
+		t.Fatalf("expected 2 attempts, got %d", len(gotBodies))
+	}
+	for i, body := range gotBodies {
+		if body != "client_id=abc" {
+			t.Fatalf("attempt %d: expected full body to be resent, got %q", i+1, body)
+		}
+	}
+}
+
+func TestRetryTransportGivesUpAfterMaxRetries(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	rt := &RetryTransport{MaxRetries: 2, BaseDelay: 0}
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected the final failing response to be returned, got %d", resp.StatusCode)
+	}
+	if atomic.LoadInt32(&attempts) != 3 {
+		t.Fatalf("expected 1 initial attempt + 2 retries = 3 requests, got %d", attempts)
+	}
+}
+
+func TestUserAgentTransportStampsUserAgent(t *testing.T) {
+	var gotUA string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotUA = r.Header.Get("User-Agent")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	rt := &UserAgentTransport{UserAgent: "test-agent/1.0"}
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if gotUA != "test-agent/1.0" {
+		t.Fatalf("expected stamped user agent, got %q", gotUA)
+	}
+}